@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	openapi_types "github.com/discord-gophers/goapi-gen/types"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
@@ -12,6 +13,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 	"journey/internal/api/spec"
+	"journey/internal/notifier"
 	"journey/internal/pgstore"
 	"net/http"
 	"time"
@@ -29,10 +31,27 @@ type store interface {
 	GetParticipants(ctx context.Context, tripID uuid.UUID) ([]pgstore.Participant, error)
 	GetTripLinks(ctx context.Context, tripID uuid.UUID) ([]pgstore.Link, error)
 	CreateTripLink(ctx context.Context, link pgstore.CreateTripLinkParams) (uuid.UUID, error)
+	TouchParticipantInviteSentAt(ctx context.Context, participantID uuid.UUID) error
+	TouchTripOwnerInviteSentAt(ctx context.Context, tripID uuid.UUID) error
+	GetUserIDBySessionToken(ctx context.Context, token string) (uuid.UUID, error)
+	CreateSession(ctx context.Context, userID uuid.UUID, ttl time.Duration) (string, error)
+	GetTripMemberRole(ctx context.Context, tripID uuid.UUID, userID uuid.UUID) (pgstore.TripMember, error)
+	AddTripMember(ctx context.Context, params pgstore.AddTripMemberParams) error
+	ReserveIdempotencyKey(ctx context.Context, params pgstore.ReserveIdempotencyKeyParams) (record pgstore.IdempotencyRecord, reserved bool, err error)
+	CompleteIdempotencyRecord(ctx context.Context, params pgstore.CompleteIdempotencyRecordParams) error
+	DeleteIdempotencyRecord(ctx context.Context, key string, userOrIP string) error
 }
 
-type mailer interface {
-	SendConfirmTripEmailToTripOwner(tripID uuid.UUID) error
+// minResendInviteInterval is the minimum time a caller must wait between
+// two resends of the same confirmation e-mail.
+const minResendInviteInterval = 60 * time.Second
+
+// Notifier durably queues an event and delivers it asynchronously to
+// whichever channels (email, SMS, webhook, ...) are configured for it.
+// Implemented by *notifier.Pool.
+type Notifier interface {
+	Notify(ctx context.Context, event string, msg notifier.Message) error
+	Shutdown(ctx context.Context) error
 }
 
 type API struct {
@@ -40,17 +59,41 @@ type API struct {
 	logger    *zap.Logger
 	validator *validator.Validate
 	pool      *pgxpool.Pool
-	mailer    mailer
+	notifier  Notifier
 }
 
-func NewApi(pool *pgxpool.Pool, logger *zap.Logger, mailer mailer) API {
+// NewApi wires up the API and starts a notifier.Pool backed by
+// outboundJobs, resuming any deliveries left pending by the last shutdown
+// or crash. Call Shutdown to drain in-flight sends before the process
+// exits.
+func NewApi(pool *pgxpool.Pool, logger *zap.Logger, events notifier.Notifier, outboundJobs notifier.Store) API {
 	validation := validator.New(validator.WithRequiredStructEnabled())
-	return API{pgstore.New(pool), logger, validation, pool, mailer}
+
+	notifierPool := notifier.NewPool(events, outboundJobs, logger, notifier.DefaultWorkers)
+	if err := notifierPool.Start(context.Background()); err != nil {
+		logger.Error("failed to resume pending outbound jobs", zap.Error(err))
+	}
+
+	return API{pgstore.New(pool), logger, validation, pool, notifierPool}
+}
+
+// Shutdown drains in-flight notifier deliveries, or returns once ctx
+// expires, whichever comes first.
+func (api *API) Shutdown(ctx context.Context) error {
+	return api.notifier.Shutdown(ctx)
 }
 
 // Confirms a participant on a trip.
 // (PATCH /participants/{participantId}/confirm)
 func (api *API) PatchParticipantsParticipantIDConfirm(w http.ResponseWriter, r *http.Request, participantID string) *spec.Response {
+	// EXPLICIT EXCEPTION to "mutating endpoints require editor", same as
+	// GetTripsTripIDConfirm: this is an e-mail-link flow with no
+	// Authorization header, so an anonymous caller is authorized by
+	// possession of the participant's UUID alone. A caller who *does* carry
+	// a session still has to pass the normal viewer check below, so a
+	// logged-in user can't confirm - and thereby add themselves as editor
+	// to - a trip they were never invited to just by guessing its
+	// participant UUIDs.
 	id, err := uuid.Parse(participantID)
 	if err != nil {
 		return spec.PatchParticipantsParticipantIDConfirmJSON400Response(spec.Error{Message: "uuid invalido"})
@@ -65,6 +108,10 @@ func (api *API) PatchParticipantsParticipantIDConfirm(w http.ResponseWriter, r *
 		return spec.PatchParticipantsParticipantIDConfirmJSON400Response(spec.Error{Message: "something went wrong, try again"})
 	}
 
+	if err := api.authorizeIfAuthenticated(r.Context(), participant.TripID, RoleViewer); err != nil {
+		return spec.PatchParticipantsParticipantIDConfirmJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	if participant.IsConfirmed {
 		return spec.PatchParticipantsParticipantIDConfirmJSON400Response(spec.Error{Message: "participant já confirmado"})
 	}
@@ -74,9 +121,80 @@ func (api *API) PatchParticipantsParticipantIDConfirm(w http.ResponseWriter, r *
 		return spec.PatchParticipantsParticipantIDConfirmJSON400Response(spec.Error{Message: "something went wrong, try again"})
 	}
 
+	userID := api.identifyCaller(w, r)
+	if err := api.store.AddTripMember(r.Context(), pgstore.AddTripMemberParams{
+		TripID: participant.TripID,
+		UserID: userID,
+		Role:   string(RoleEditor),
+	}); err != nil {
+		api.logger.Error("failed to promote confirmed participant to editor",
+			zap.Error(err), zap.String("participant_id", participantID))
+	}
+
 	return spec.PatchParticipantsParticipantIDConfirmJSON204Response(nil)
 }
 
+// Resend the confirmation e-mail to a participant who hasn't confirmed yet.
+// (POST /participants/{participantId}/resend-invite)
+func (api *API) PostParticipantsParticipantIDResendInvite(w http.ResponseWriter, r *http.Request, participantID string) *spec.Response {
+	id, err := uuid.Parse(participantID)
+	if err != nil {
+		return spec.PostParticipantsParticipantIDResendInviteJSON400Response(spec.Error{Message: "uuid invalido"})
+	}
+
+	participant, err := api.store.GetParticipant(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return spec.PostParticipantsParticipantIDResendInviteJSON400Response(spec.Error{Message: "participant não encontrado"})
+		}
+		api.logger.Error("failed to get participant", zap.Error(err), zap.String("participant_id", participantID))
+		return spec.PostParticipantsParticipantIDResendInviteJSON400Response(spec.Error{Message: "something went wrong, try again"})
+	}
+
+	if err := api.authorize(r.Context(), participant.TripID, RoleEditor); err != nil {
+		return spec.PostParticipantsParticipantIDResendInviteJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
+	if participant.IsConfirmed {
+		return spec.PostParticipantsParticipantIDResendInviteJSON400Response(spec.Error{Message: "participant já confirmado"})
+	}
+
+	if participant.LastInviteSentAt.Valid && time.Since(participant.LastInviteSentAt.Time) < minResendInviteInterval {
+		return spec.PostParticipantsParticipantIDResendInviteJSON429Response(spec.Error{Message: "convite reenviado recentemente, tente novamente mais tarde"})
+	}
+
+	trip, err := api.store.GetTrip(r.Context(), participant.TripID)
+	if err != nil {
+		api.logger.Error("failed to get trip", zap.Error(err), zap.String("participant_id", participantID))
+		return spec.PostParticipantsParticipantIDResendInviteJSON400Response(spec.Error{Message: "something went wrong, try again"})
+	}
+
+	if err := api.store.TouchParticipantInviteSentAt(r.Context(), id); err != nil {
+		api.logger.Error("failed to touch participant invite timestamp", zap.Error(err), zap.String("participant_id", participantID))
+		return spec.PostParticipantsParticipantIDResendInviteJSON400Response(spec.Error{Message: "something went wrong, try again"})
+	}
+
+	if err := api.notifier.Notify(r.Context(), "participant.invited", notifier.Message{
+		To:       participant.Email,
+		Channel:  notifier.ChannelEmail,
+		Template: "participant-invite",
+		Data: map[string]string{
+			"tripID":      trip.ID.String(),
+			"ownerName":   trip.OwnerName,
+			"ownerEmail":  trip.OwnerEmail,
+			"destination": trip.Destination,
+			"startsAt":    trip.StartsAt.Time.Format(time.DateOnly),
+			"confirmURL":  fmt.Sprintf("https://journey.com/participants/%s/confirm", id.String()),
+		},
+	}); err != nil {
+		api.logger.Error("failed to enqueue participant.invited event",
+			zap.Error(err),
+			zap.String("participant_id", participantID))
+	}
+
+	return spec.PostParticipantsParticipantIDResendInviteJSON204Response(nil)
+}
+
 // Create a new trip
 // (POST /trips)
 func (api *API) PostTrips(w http.ResponseWriter, r *http.Request) *spec.Response {
@@ -94,13 +212,31 @@ func (api *API) PostTrips(w http.ResponseWriter, r *http.Request) *spec.Response
 		return spec.PostTripsJSON400Response(spec.Error{Message: "failed to create trip, try again"})
 	}
 
-	go func() {
-		if err := api.mailer.SendConfirmTripEmailToTripOwner(tripID); err != nil {
-			api.logger.Error("failed to send email on PostTrips: %w",
-				zap.Error(err),
-				zap.String("trip_id", tripID.String()))
-		}
-	}()
+	userID := api.identifyCaller(w, r)
+	if err := api.store.AddTripMember(r.Context(), pgstore.AddTripMemberParams{
+		TripID: tripID,
+		UserID: userID,
+		Role:   string(RoleOwner),
+	}); err != nil {
+		api.logger.Error("failed to add trip owner membership",
+			zap.Error(err), zap.String("trip_id", tripID.String()))
+	}
+
+	if err := api.notifier.Notify(r.Context(), "trip.created", notifier.Message{
+		To:       string(body.OwnerEmail),
+		Channel:  notifier.ChannelEmail,
+		Template: "trip-owner-confirm",
+		Data: map[string]string{
+			"ownerName":   body.OwnerName,
+			"destination": body.Destination,
+			"startsAt":    body.StartsAt.Format(time.DateOnly),
+			"confirmURL":  fmt.Sprintf("https://journey.com/trips/%s/confirm", tripID.String()),
+		},
+	}); err != nil {
+		api.logger.Error("failed to enqueue trip.created event",
+			zap.Error(err),
+			zap.String("trip_id", tripID.String()))
+	}
 
 	return spec.PostTripsJSON201Response(spec.CreateTripResponse{TripID: tripID.String()})
 }
@@ -113,6 +249,10 @@ func (api *API) GetTripsTripID(w http.ResponseWriter, r *http.Request, tripID st
 		return spec.GetTripsTripIDJSON400Response(spec.Error{Message: "uuid invalido"})
 	}
 
+	if err := api.authorize(r.Context(), id, RoleViewer); err != nil {
+		return spec.GetTripsTripIDJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	trip, err := api.store.GetTrip(r.Context(), id)
 	if err != nil {
 		return spec.GetTripsTripIDJSON400Response(spec.Error{Message: "This trip dont exists, try again"})
@@ -135,6 +275,10 @@ func (api *API) PutTripsTripID(w http.ResponseWriter, r *http.Request, tripID st
 		return spec.PutTripsTripIDJSON400Response(spec.Error{Message: "uuid invalido"})
 	}
 
+	if err := api.authorize(r.Context(), id, RoleEditor); err != nil {
+		return spec.PutTripsTripIDJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	var body spec.PutTripsTripIDJSONRequestBody
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		return spec.PutTripsTripIDJSON400Response(spec.Error{Message: "Invalid JSON: " + err.Error()})
@@ -176,6 +320,10 @@ func (api *API) GetTripsTripIDActivities(w http.ResponseWriter, r *http.Request,
 		return spec.GetTripsTripIDActivitiesJSON400Response(spec.Error{Message: "uuid invalido"})
 	}
 
+	if err := api.authorize(r.Context(), id, RoleViewer); err != nil {
+		return spec.GetTripsTripIDActivitiesJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	activities, err := api.store.GetTripActivities(r.Context(), id)
 	if err != nil {
 		return spec.GetTripsTripIDActivitiesJSON400Response(spec.Error{Message: "Activities for this trip not found: " + err.Error()})
@@ -218,6 +366,10 @@ func (api *API) PostTripsTripIDActivities(w http.ResponseWriter, r *http.Request
 		return spec.PostTripsTripIDActivitiesJSON400Response(spec.Error{Message: "Invalid Id: " + err.Error()})
 	}
 
+	if err := api.authorize(r.Context(), id, RoleEditor); err != nil {
+		return spec.PostTripsTripIDActivitiesJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	_, err = api.store.GetTrip(r.Context(), id)
 	if err != nil {
 		return spec.PostTripsTripIDActivitiesJSON400Response(spec.Error{Message: "Somethind went wrong with this trip"})
@@ -245,16 +397,37 @@ func (api *API) PostTripsTripIDActivities(w http.ResponseWriter, r *http.Request
 // Confirm a trip and send e-mail invitations.
 // (GET /trips/{tripId}/confirm)
 func (api *API) GetTripsTripIDConfirm(w http.ResponseWriter, r *http.Request, tripID string) *spec.Response {
+	// EXPLICIT EXCEPTION to "mutating endpoints require editor": this is an
+	// e-mail-link flow, the owner reaches it by clicking a link in their
+	// inbox with no Authorization header attached, so an anonymous caller
+	// is authorized by possession of the trip's UUID rather than a session
+	// role - same trust model as the participant confirm link. That only
+	// covers the anonymous case, though: if the caller *does* carry a
+	// session (e.g. a logged-in user probing a trip UUID they don't belong
+	// to), they still have to pass the normal viewer check below rather
+	// than being waved through on UUID alone.
 	id, err := uuid.Parse(tripID)
 	if err != nil {
 		return spec.GetTripsTripIDConfirmJSON400Response(spec.Error{Message: "uuid invalido"})
 	}
 
+	if err := api.authorizeIfAuthenticated(r.Context(), id, RoleViewer); err != nil {
+		return spec.GetTripsTripIDConfirmJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	trip, err := api.store.GetTrip(r.Context(), id)
 	if err != nil {
 		return spec.GetTripsTripIDConfirmJSON400Response(spec.Error{Message: "Trip to update not found: " + err.Error()})
 	}
 
+	// A bare GET link with no CSRF/idempotency protection gets hit more than
+	// once in practice - mail clients and link-scanners routinely prefetch
+	// it. Skip the mutation and the trip.confirmed e-mail once the trip is
+	// already confirmed instead of re-sending it on every click.
+	if trip.IsConfirmed {
+		return spec.GetTripsTripIDConfirmJSON204Response("")
+	}
+
 	err = api.store.UpdateTrip(r.Context(), pgstore.UpdateTripParams{
 		Destination: trip.Destination,
 		EndsAt:      pgtype.Timestamp{Valid: true, Time: trip.EndsAt.Time},
@@ -266,9 +439,73 @@ func (api *API) GetTripsTripIDConfirm(w http.ResponseWriter, r *http.Request, tr
 		return spec.GetTripsTripIDConfirmJSON400Response(spec.Error{Message: "Error when confirm a trip: " + err.Error()})
 	}
 
+	if err := api.notifier.Notify(r.Context(), "trip.confirmed", notifier.Message{
+		To:       trip.OwnerEmail,
+		Channel:  notifier.ChannelEmail,
+		Template: "trip-confirmed",
+		Data: map[string]string{
+			"ownerName":   trip.OwnerName,
+			"destination": trip.Destination,
+			"startsAt":    trip.StartsAt.Time.Format(time.DateOnly),
+		},
+	}); err != nil {
+		api.logger.Error("failed to enqueue trip.confirmed event",
+			zap.Error(err),
+			zap.String("trip_id", tripID))
+	}
+
 	return spec.GetTripsTripIDConfirmJSON204Response("")
 }
 
+// Resend the confirmation e-mail to a trip's owner.
+// (POST /trips/{tripId}/resend-owner-confirm)
+func (api *API) PostTripsTripIDResendOwnerConfirm(w http.ResponseWriter, r *http.Request, tripID string) *spec.Response {
+	id, err := uuid.Parse(tripID)
+	if err != nil {
+		return spec.PostTripsTripIDResendOwnerConfirmJSON400Response(spec.Error{Message: "uuid invalido"})
+	}
+
+	if err := api.authorize(r.Context(), id, RoleOwner); err != nil {
+		return spec.PostTripsTripIDResendOwnerConfirmJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
+	trip, err := api.store.GetTrip(r.Context(), id)
+	if err != nil {
+		return spec.PostTripsTripIDResendOwnerConfirmJSON400Response(spec.Error{Message: "Trip not found: " + err.Error()})
+	}
+
+	if trip.IsConfirmed {
+		return spec.PostTripsTripIDResendOwnerConfirmJSON400Response(spec.Error{Message: "trip já confirmada"})
+	}
+
+	if trip.OwnerInviteSentAt.Valid && time.Since(trip.OwnerInviteSentAt.Time) < minResendInviteInterval {
+		return spec.PostTripsTripIDResendOwnerConfirmJSON429Response(spec.Error{Message: "confirmação reenviada recentemente, tente novamente mais tarde"})
+	}
+
+	if err := api.store.TouchTripOwnerInviteSentAt(r.Context(), id); err != nil {
+		api.logger.Error("failed to touch trip owner invite timestamp", zap.Error(err), zap.String("trip_id", tripID))
+		return spec.PostTripsTripIDResendOwnerConfirmJSON400Response(spec.Error{Message: "something went wrong, try again"})
+	}
+
+	if err := api.notifier.Notify(r.Context(), "trip.created", notifier.Message{
+		To:       trip.OwnerEmail,
+		Channel:  notifier.ChannelEmail,
+		Template: "trip-owner-confirm",
+		Data: map[string]string{
+			"ownerName":   trip.OwnerName,
+			"destination": trip.Destination,
+			"startsAt":    trip.StartsAt.Time.Format(time.DateOnly),
+			"confirmURL":  fmt.Sprintf("https://journey.com/trips/%s/confirm", id.String()),
+		},
+	}); err != nil {
+		api.logger.Error("failed to enqueue trip.created event",
+			zap.Error(err),
+			zap.String("trip_id", tripID))
+	}
+
+	return spec.PostTripsTripIDResendOwnerConfirmJSON204Response(nil)
+}
+
 // Invite someone to the trip.
 // (POST /trips/{tripId}/invites)
 func (api *API) PostTripsTripIDInvites(w http.ResponseWriter, r *http.Request, tripID string) *spec.Response {
@@ -282,6 +519,10 @@ func (api *API) PostTripsTripIDInvites(w http.ResponseWriter, r *http.Request, t
 		return spec.PostTripsTripIDInvitesJSON400Response(spec.Error{Message: "Invalid Id: " + err.Error()})
 	}
 
+	if err := api.authorize(r.Context(), id, RoleEditor); err != nil {
+		return spec.PostTripsTripIDInvitesJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	if err := api.store.InviteParticipantToATrip(r.Context(), pgstore.InviteParticipantsToTripParams{
 		TripID: id,
 		Email:  string(body.Email),
@@ -289,6 +530,27 @@ func (api *API) PostTripsTripIDInvites(w http.ResponseWriter, r *http.Request, t
 		return spec.PostTripsTripIDInvitesJSON400Response(spec.Error{Message: "Failed to invite participant to a trip" + err.Error()})
 	}
 
+	trip, err := api.store.GetTrip(r.Context(), id)
+	if err == nil {
+		if err := api.notifier.Notify(r.Context(), "participant.invited", notifier.Message{
+			To:       string(body.Email),
+			Channel:  notifier.ChannelEmail,
+			Template: "participant-invite",
+			Data: map[string]string{
+				"tripID":      trip.ID.String(),
+				"ownerName":   trip.OwnerName,
+				"ownerEmail":  trip.OwnerEmail,
+				"destination": trip.Destination,
+				"startsAt":    trip.StartsAt.Time.Format(time.DateOnly),
+				"confirmURL":  fmt.Sprintf("https://journey.com/trips/%s/confirm", id.String()),
+			},
+		}); err != nil {
+			api.logger.Error("failed to enqueue participant.invited event",
+				zap.Error(err),
+				zap.String("trip_id", tripID))
+		}
+	}
+
 	return spec.PostTripsTripIDInvitesJSON201Response(nil)
 }
 
@@ -300,6 +562,10 @@ func (api *API) GetTripsTripIDLinks(w http.ResponseWriter, r *http.Request, trip
 		return spec.GetTripsTripIDLinksJSON400Response(spec.Error{Message: "Invalid Trip UUID: " + err.Error()})
 	}
 
+	if err := api.authorize(r.Context(), id, RoleViewer); err != nil {
+		return spec.GetTripsTripIDLinksJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	links, err := api.store.GetTripLinks(r.Context(), id)
 	if err != nil {
 		return spec.GetTripsTripIDLinksJSON400Response(spec.Error{Message: "Failed to get Trip links: " + err.Error()})
@@ -331,6 +597,10 @@ func (api *API) PostTripsTripIDLinks(w http.ResponseWriter, r *http.Request, tri
 		spec.PostTripsTripIDLinksJSON400Response(spec.Error{Message: "Invalid Id: " + err.Error()})
 	}
 
+	if err := api.authorize(r.Context(), id, RoleEditor); err != nil {
+		return spec.PostTripsTripIDLinksJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	if err := api.validator.Struct(body); err != nil {
 		return spec.PostTripsTripIDLinksJSON400Response(spec.Error{Message: "invalid input: " + err.Error()})
 	}
@@ -355,6 +625,10 @@ func (api *API) GetTripsTripIDParticipants(w http.ResponseWriter, r *http.Reques
 		return spec.GetTripsTripIDParticipantsJSON400Response(spec.Error{Message: "Trip id invalid: " + err.Error()})
 	}
 
+	if err := api.authorize(r.Context(), id, RoleViewer); err != nil {
+		return spec.GetTripsTripIDParticipantsJSON403Response(spec.Error{Message: "you don't have access to this trip"})
+	}
+
 	participants, err := api.store.GetParticipants(r.Context(), id)
 	if err != nil {
 		return spec.GetTripsTripIDParticipantsJSON400Response(spec.Error{Message: "Error to get the trip participants: " + err.Error()})
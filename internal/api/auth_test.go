@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"journey/internal/api/spec"
+	"journey/internal/pgstore"
+)
+
+// authFakeStore implements the store interface, returning member/memberErr
+// from GetTripMemberRole and zero values everywhere else - authorize is the
+// only thing under test here.
+type authFakeStore struct {
+	member    pgstore.TripMember
+	memberErr error
+}
+
+func (f *authFakeStore) CreateTrip(context.Context, *pgxpool.Pool, spec.CreateTripRequest) (uuid.UUID, error) {
+	return uuid.UUID{}, nil
+}
+func (f *authFakeStore) GetParticipant(context.Context, uuid.UUID) (pgstore.Participant, error) {
+	return pgstore.Participant{}, nil
+}
+func (f *authFakeStore) ConfirmParticipant(context.Context, uuid.UUID) error { return nil }
+func (f *authFakeStore) GetTrip(context.Context, uuid.UUID) (pgstore.Trip, error) {
+	return pgstore.Trip{}, nil
+}
+func (f *authFakeStore) UpdateTrip(context.Context, pgstore.UpdateTripParams) error { return nil }
+func (f *authFakeStore) GetTripActivities(context.Context, uuid.UUID) ([]pgstore.Activity, error) {
+	return nil, nil
+}
+func (f *authFakeStore) CreateActivity(context.Context, pgstore.CreateActivityParams) (uuid.UUID, error) {
+	return uuid.UUID{}, nil
+}
+func (f *authFakeStore) InviteParticipantToATrip(context.Context, pgstore.InviteParticipantsToTripParams) error {
+	return nil
+}
+func (f *authFakeStore) GetParticipants(context.Context, uuid.UUID) ([]pgstore.Participant, error) {
+	return nil, nil
+}
+func (f *authFakeStore) GetTripLinks(context.Context, uuid.UUID) ([]pgstore.Link, error) {
+	return nil, nil
+}
+func (f *authFakeStore) CreateTripLink(context.Context, pgstore.CreateTripLinkParams) (uuid.UUID, error) {
+	return uuid.UUID{}, nil
+}
+func (f *authFakeStore) TouchParticipantInviteSentAt(context.Context, uuid.UUID) error { return nil }
+func (f *authFakeStore) TouchTripOwnerInviteSentAt(context.Context, uuid.UUID) error   { return nil }
+func (f *authFakeStore) GetUserIDBySessionToken(context.Context, string) (uuid.UUID, error) {
+	return uuid.UUID{}, nil
+}
+func (f *authFakeStore) CreateSession(context.Context, uuid.UUID, time.Duration) (string, error) {
+	return "", nil
+}
+func (f *authFakeStore) GetTripMemberRole(context.Context, uuid.UUID, uuid.UUID) (pgstore.TripMember, error) {
+	return f.member, f.memberErr
+}
+func (f *authFakeStore) AddTripMember(context.Context, pgstore.AddTripMemberParams) error { return nil }
+func (f *authFakeStore) ReserveIdempotencyKey(context.Context, pgstore.ReserveIdempotencyKeyParams) (pgstore.IdempotencyRecord, bool, error) {
+	return pgstore.IdempotencyRecord{}, false, nil
+}
+func (f *authFakeStore) CompleteIdempotencyRecord(context.Context, pgstore.CompleteIdempotencyRecordParams) error {
+	return nil
+}
+func (f *authFakeStore) DeleteIdempotencyRecord(context.Context, string, string) error { return nil }
+
+func TestAuthorize(t *testing.T) {
+	tripID := uuid.New()
+	userID := uuid.New()
+	errStoreDown := errors.New("store unreachable")
+
+	tests := []struct {
+		name        string
+		anonymous   bool
+		member      pgstore.TripMember
+		memberErr   error
+		required    Role
+		wantAllowed bool
+	}{
+		{name: "no caller is forbidden", anonymous: true, required: RoleViewer, wantAllowed: false},
+		{name: "failed member lookup is forbidden", memberErr: errStoreDown, required: RoleViewer, wantAllowed: false},
+		{name: "viewer satisfies viewer", member: pgstore.TripMember{Role: string(RoleViewer)}, required: RoleViewer, wantAllowed: true},
+		{name: "viewer does not satisfy editor", member: pgstore.TripMember{Role: string(RoleViewer)}, required: RoleEditor, wantAllowed: false},
+		{name: "editor satisfies viewer", member: pgstore.TripMember{Role: string(RoleEditor)}, required: RoleViewer, wantAllowed: true},
+		{name: "editor does not satisfy owner", member: pgstore.TripMember{Role: string(RoleEditor)}, required: RoleOwner, wantAllowed: false},
+		{name: "owner satisfies editor", member: pgstore.TripMember{Role: string(RoleOwner)}, required: RoleEditor, wantAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{store: &authFakeStore{member: tt.member, memberErr: tt.memberErr}}
+
+			ctx := context.Background()
+			if !tt.anonymous {
+				ctx = context.WithValue(ctx, userIDContextKey{}, userID)
+			}
+
+			err := api.authorize(ctx, tripID, tt.required)
+			allowed := err == nil
+			if allowed != tt.wantAllowed {
+				t.Fatalf("authorize() allowed=%v, want %v (err=%v)", allowed, tt.wantAllowed, err)
+			}
+			if err != nil && !errors.Is(err, errForbidden) {
+				t.Fatalf("authorize() returned %v, want errForbidden", err)
+			}
+		})
+	}
+}
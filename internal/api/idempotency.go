@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go.uber.org/zap"
+	"io"
+	"journey/internal/pgstore"
+	"net/http"
+)
+
+// IdempotencyMiddleware makes retried POSTs safe: a client that resends the
+// same Idempotency-Key gets back the cached response instead of creating a
+// duplicate trip/invite/link, and a key reused with a different request
+// body is rejected with 409 instead of silently returning stale data. A key
+// is scoped to the caller that chose it (callerIdentity), so two different
+// callers picking the same key never collide on each other's reservation.
+// ReserveIdempotencyKey treats records older than 24h as expired, so a key
+// can be reused after that window.
+//
+// The key is reserved with an atomic insert before the handler runs, so two
+// concurrent requests with the same key can't both execute it: the loser
+// of the race gets told to retry instead of triggering the side effect
+// twice. Only a successful (2xx) response is cached; a transient failure
+// releases the reservation so a retry with the same key can still succeed,
+// instead of replaying the failure for 24h.
+func (api *API) IdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := hashIdempotentRequest(body)
+		userOrIP := callerIdentity(r)
+
+		record, reserved, err := api.store.ReserveIdempotencyKey(r.Context(), pgstore.ReserveIdempotencyKeyParams{
+			Key:         key,
+			UserOrIP:    userOrIP,
+			RequestHash: requestHash,
+		})
+		if err != nil {
+			api.logger.Error("failed to reserve idempotency key", zap.Error(err), zap.String("idempotency_key", key))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !reserved {
+			if record.RequestHash != requestHash {
+				http.Error(w, "Idempotency-Key already used with a different request", http.StatusConflict)
+				return
+			}
+
+			if !record.ResponseStatus.Valid {
+				http.Error(w, "a request with this Idempotency-Key is already being processed", http.StatusConflict)
+				return
+			}
+
+			for name, values := range decodeResponseHeaders(record.ResponseHeaders) {
+				for _, value := range values {
+					w.Header().Add(name, value)
+				}
+			}
+			w.WriteHeader(int(record.ResponseStatus.Int32))
+			_, _ = w.Write(record.ResponseBody)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status < 200 || rec.status >= 300 {
+			if err := api.store.DeleteIdempotencyRecord(r.Context(), key, userOrIP); err != nil {
+				api.logger.Error("failed to release idempotency reservation", zap.Error(err), zap.String("idempotency_key", key))
+			}
+			return
+		}
+
+		headers, err := json.Marshal(rec.header)
+		if err != nil {
+			api.logger.Error("failed to encode response headers for idempotency record", zap.Error(err), zap.String("idempotency_key", key))
+		}
+
+		if err := api.store.CompleteIdempotencyRecord(r.Context(), pgstore.CompleteIdempotencyRecordParams{
+			Key:             key,
+			UserOrIP:        userOrIP,
+			ResponseBody:    rec.body.Bytes(),
+			ResponseStatus:  int32(rec.status),
+			ResponseHeaders: headers,
+		}); err != nil {
+			api.logger.Error("failed to complete idempotency record", zap.Error(err), zap.String("idempotency_key", key))
+		}
+	})
+}
+
+// decodeResponseHeaders unmarshals headers persisted by CompleteIdempotencyRecord.
+// A malformed or absent value (e.g. records written before response_headers
+// existed) just replays with no extra headers instead of failing the request.
+func decodeResponseHeaders(raw []byte) http.Header {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var headers http.Header
+	if err := json.Unmarshal(raw, &headers); err != nil {
+		return nil
+	}
+
+	return headers
+}
+
+func hashIdempotentRequest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// callerIdentity scopes an idempotency record to whoever sent it: the
+// authenticated user when there is one, otherwise the remote address.
+func callerIdentity(r *http.Request) string {
+	if userID, ok := userIDFromContext(r.Context()); ok {
+		return userID.String()
+	}
+	return r.RemoteAddr
+}
+
+// idempotencyRecorder captures a handler's status code, headers and body so
+// they can be persisted and replayed verbatim for a repeated Idempotency-Key,
+// while still writing through to the real ResponseWriter for the current
+// request. Headers are snapshotted at WriteHeader time, since that's the
+// point at which the real ResponseWriter freezes them - anything a handler
+// sets on Header() before then (e.g. identifyCaller's X-Session-Token) is
+// captured; anything set after has no effect on the live response either.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	header http.Header
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	r.status = status
+	r.header = r.ResponseWriter.Header().Clone()
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.header == nil {
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+	"journey/internal/pgstore"
+)
+
+// idempotencyRecordKey scopes a reservation to (key, user_or_ip), the same
+// composite uniqueness the idempotency_records table enforces: an
+// Idempotency-Key is only meaningful within the caller that picked it.
+type idempotencyRecordKey struct {
+	key      string
+	userOrIP string
+}
+
+// idempotencyFakeStore guards its records with a mutex to mimic the atomic
+// insert ReserveIdempotencyKey does at the database level: only the first
+// caller for a given (key, user_or_ip) reserves it, every other concurrent
+// caller for the same pair observes the reservation already in place.
+type idempotencyFakeStore struct {
+	authFakeStore
+
+	mu      sync.Mutex
+	records map[idempotencyRecordKey]pgstore.IdempotencyRecord
+}
+
+func (f *idempotencyFakeStore) ReserveIdempotencyKey(_ context.Context, params pgstore.ReserveIdempotencyKeyParams) (pgstore.IdempotencyRecord, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.records == nil {
+		f.records = make(map[idempotencyRecordKey]pgstore.IdempotencyRecord)
+	}
+
+	recKey := idempotencyRecordKey{key: params.Key, userOrIP: params.UserOrIP}
+	if existing, ok := f.records[recKey]; ok {
+		return existing, false, nil
+	}
+
+	f.records[recKey] = pgstore.IdempotencyRecord{Key: params.Key, RequestHash: params.RequestHash}
+	return pgstore.IdempotencyRecord{}, true, nil
+}
+
+func (f *idempotencyFakeStore) CompleteIdempotencyRecord(_ context.Context, params pgstore.CompleteIdempotencyRecordParams) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.records[idempotencyRecordKey{key: params.Key, userOrIP: params.UserOrIP}] = pgstore.IdempotencyRecord{
+		Key:            params.Key,
+		ResponseBody:   params.ResponseBody,
+		ResponseStatus: pgtype.Int4{Int32: params.ResponseStatus, Valid: true},
+	}
+	return nil
+}
+
+func (f *idempotencyFakeStore) DeleteIdempotencyRecord(_ context.Context, key string, userOrIP string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.records, idempotencyRecordKey{key: key, userOrIP: userOrIP})
+	return nil
+}
+
+// TestIdempotencyMiddleware_ConcurrentSameKeyRunsHandlerOnce exercises the
+// reservation race the middleware exists to close: N concurrent POSTs with
+// the same Idempotency-Key and body must only let one of them reach the
+// handler and trigger its side effect, no matter how they interleave.
+func TestIdempotencyMiddleware_ConcurrentSameKeyRunsHandlerOnce(t *testing.T) {
+	const concurrency = 20
+	body := []byte(`{"trip":"paris"}`)
+
+	var handlerCalls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&handlerCalls, 1)
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"tripID":"1"}`))
+	})
+
+	api := &API{store: &idempotencyFakeStore{}, logger: zap.NewNop()}
+	wrapped := api.IdempotencyMiddleware(handler)
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodPost, "/trips", bytes.NewReader(body))
+			req.Header.Set("Idempotency-Key", "same-key")
+			rec := httptest.NewRecorder()
+
+			<-start
+			wrapped.ServeHTTP(rec, req)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&handlerCalls); calls != 1 {
+		t.Fatalf("expected the handler to run exactly once across %d concurrent requests with the same Idempotency-Key, ran %d times", concurrency, calls)
+	}
+}
+
+// TestIdempotencyMiddleware_SameKeyDifferentCallerDoesNotCollide ensures two
+// different callers who happen to pick the same Idempotency-Key don't share
+// a reservation: each must run the handler and get its own response, rather
+// than the second caller being rejected with 409 (or worse, silently handed
+// back the first caller's cached body) just because of someone else's key
+// choice.
+func TestIdempotencyMiddleware_SameKeyDifferentCallerDoesNotCollide(t *testing.T) {
+	var handlerCalls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&handlerCalls, 1)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"tripID":"` + r.RemoteAddr + `"}`))
+	})
+
+	api := &API{store: &idempotencyFakeStore{}, logger: zap.NewNop()}
+	wrapped := api.IdempotencyMiddleware(handler)
+
+	req1 := httptest.NewRequest(http.MethodPost, "/trips", bytes.NewReader([]byte(`{"trip":"paris"}`)))
+	req1.Header.Set("Idempotency-Key", "same-key")
+	req1.RemoteAddr = "10.0.0.1:1111"
+	rec1 := httptest.NewRecorder()
+	wrapped.ServeHTTP(rec1, req1)
+
+	req2 := httptest.NewRequest(http.MethodPost, "/trips", bytes.NewReader([]byte(`{"trip":"tokyo"}`)))
+	req2.Header.Set("Idempotency-Key", "same-key")
+	req2.RemoteAddr = "10.0.0.2:2222"
+	rec2 := httptest.NewRecorder()
+	wrapped.ServeHTTP(rec2, req2)
+
+	if calls := atomic.LoadInt32(&handlerCalls); calls != 2 {
+		t.Fatalf("expected both callers to run the handler despite sharing an Idempotency-Key, ran %d times", calls)
+	}
+	if rec1.Code != http.StatusCreated || rec2.Code != http.StatusCreated {
+		t.Fatalf("expected both callers to get a fresh 201, got %d and %d", rec1.Code, rec2.Code)
+	}
+	if rec1.Body.String() == rec2.Body.String() {
+		t.Fatalf("expected distinct responses per caller, both got %q", rec1.Body.String())
+	}
+}
@@ -0,0 +1,15 @@
+// Package noop provides a notifier.Provider that discards every message.
+// Useful in tests and local development when no real channel is configured.
+package noop
+
+import (
+	"context"
+	"journey/internal/notifier"
+)
+
+// Provider discards every notifier.Message it receives.
+type Provider struct{}
+
+func (Provider) Send(context.Context, notifier.Message) error {
+	return nil
+}
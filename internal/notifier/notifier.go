@@ -0,0 +1,65 @@
+// Package notifier decouples handlers from any specific transport (email,
+// SMS, webhook, ...). Handlers publish an event with a Message; the
+// Notifier routes that Message to every Provider registered for its
+// channel, so operators can wire SMTP, webhooks, or SMS without touching
+// handler code.
+package notifier
+
+import (
+	"context"
+	"fmt"
+)
+
+// Channel identifies the transport a Message should be delivered over.
+type Channel string
+
+const (
+	ChannelEmail   Channel = "email"
+	ChannelSMS     Channel = "sms"
+	ChannelWebhook Channel = "webhook"
+)
+
+// Message is a single notification to deliver.
+type Message struct {
+	To       string
+	Channel  Channel
+	Template string
+	Data     map[string]string
+}
+
+// Provider delivers a Message over a single channel.
+type Provider interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Notifier routes an event to every Provider registered for its message's
+// channel. Registering more than one provider under the same channel fans
+// the message out to all of them.
+type Notifier struct {
+	providers map[Channel][]Provider
+}
+
+// New creates a Notifier that dispatches to providers, keyed by channel.
+func New(providers map[Channel][]Provider) Notifier {
+	return Notifier{providers: providers}
+}
+
+// Notify publishes event by sending msg through every provider registered
+// for msg.Channel. event is informational (e.g. "trip.created") and is not
+// used for routing. Providers are called in registration order and Notify
+// returns at the first one that fails; the providers after it are not
+// called for this attempt.
+func (n Notifier) Notify(ctx context.Context, event string, msg Message) error {
+	providers, ok := n.providers[msg.Channel]
+	if !ok || len(providers) == 0 {
+		return fmt.Errorf("notifier: no provider registered for channel %q (event %q)", msg.Channel, event)
+	}
+
+	for _, provider := range providers {
+		if err := provider.Send(ctx, msg); err != nil {
+			return fmt.Errorf("notifier: failed to send event %q over %q: %w", event, msg.Channel, err)
+		}
+	}
+
+	return nil
+}
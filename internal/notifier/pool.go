@@ -0,0 +1,358 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWorkers is the number of delivery workers a Pool starts when the
+// caller has no specific reason to pick another number.
+const DefaultWorkers = 4
+
+const (
+	maxAttempts    = 5
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+	batchWindow    = 5 * time.Second
+	deliverTimeout = 30 * time.Second
+
+	eventParticipantInvited      = "participant.invited"
+	eventParticipantInvitedBatch = "participant.invited.batch"
+)
+
+// PersistedJob is a queued Message as stored in the outbound_emails table,
+// so pending sends survive a process restart.
+type PersistedJob struct {
+	ID      uuid.UUID
+	Event   string
+	Message Message
+	Attempt int
+}
+
+// Store persists queued jobs so delivery can resume after a restart.
+type Store interface {
+	EnqueueJob(ctx context.Context, event string, msg Message) (uuid.UUID, error)
+	MarkJobSent(ctx context.Context, id uuid.UUID) error
+	MarkJobFailed(ctx context.Context, id uuid.UUID, attempt int, lastError string) error
+	ListPendingJobs(ctx context.Context) ([]PersistedJob, error)
+}
+
+// Pool durably queues Messages and delivers them through a Notifier from a
+// pool of worker goroutines, retrying failed sends with exponential
+// backoff. Every Message is persisted before Notify returns; a
+// "participant.invited" event additionally waits batchWindow for further
+// invites to the same trip and delivers them as a single digest e-mail to
+// the trip owner, but each invite is already durable the moment Notify
+// returns, so a crash mid-window merely means the pending invites are
+// redelivered individually the next time Start runs.
+type Pool struct {
+	notifier Notifier
+	store    Store
+	logger   *zap.Logger
+	jobs     chan PersistedJob
+
+	batchMu sync.Mutex
+	batches map[string]*inviteBatch
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+type inviteBatch struct {
+	jobs  []PersistedJob
+	timer *time.Timer
+}
+
+// NewPool creates a Pool with workers goroutines draining jobs persisted
+// in store and delivered through notifier.
+func NewPool(notifier Notifier, store Store, logger *zap.Logger, workers int) *Pool {
+	p := &Pool{
+		notifier: notifier,
+		store:    store,
+		logger:   logger,
+		jobs:     make(chan PersistedJob, 256),
+		batches:  make(map[string]*inviteBatch),
+		done:     make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	return p
+}
+
+// Start requeues jobs that were persisted but never confirmed sent before
+// the last shutdown or crash.
+func (p *Pool) Start(ctx context.Context) error {
+	pending, err := p.store.ListPendingJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("notifier: failed to list pending jobs: %w", err)
+	}
+
+	for _, job := range pending {
+		p.send(job)
+	}
+
+	return nil
+}
+
+// Notify persists msg and returns as soon as it's durably queued; the
+// caller doesn't wait for delivery. A "participant.invited" event is held
+// for batchWindow to coalesce with other invites to the same trip into a
+// single digest e-mail, but msg is written to the outbound_emails table
+// immediately, before this method returns, not when the batch window
+// closes.
+func (p *Pool) Notify(ctx context.Context, event string, msg Message) error {
+	id, err := p.store.EnqueueJob(ctx, event, msg)
+	if err != nil {
+		return fmt.Errorf("notifier: failed to persist job: %w", err)
+	}
+
+	job := PersistedJob{ID: id, Event: event, Message: msg}
+
+	if event == eventParticipantInvited {
+		p.scheduleBatch(job)
+		return nil
+	}
+
+	p.send(job)
+	return nil
+}
+
+// send hands job to a worker, or drops it if the pool is shutting down: a
+// dropped job stays "pending" in the store and is picked up by the next
+// Start.
+func (p *Pool) send(job PersistedJob) {
+	select {
+	case p.jobs <- job:
+	case <-p.done:
+	}
+}
+
+// scheduleBatch adds job to the pending batch for its trip, starting a
+// batchWindow timer the first time a trip is seen. Every job in the batch
+// is already durably persisted; the timer only decides when to render and
+// deliver the digest.
+//
+// Shutdown closes p.done and then drains p.batches under batchMu before it
+// ever calls wg.Wait, so checking p.done here while still holding batchMu is
+// enough to rule out a new wg.Add racing a wg.Wait already in progress:
+// either this runs first and Shutdown's drain sees (and cancels) the new
+// batch before it starts waiting, or Shutdown's close(p.done) happens first
+// and this observes it, in which case it falls back to sending the job
+// individually instead of registering a batch Shutdown will never see.
+func (p *Pool) scheduleBatch(job PersistedJob) {
+	tripID := job.Message.Data["tripID"]
+
+	p.batchMu.Lock()
+	defer p.batchMu.Unlock()
+
+	select {
+	case <-p.done:
+		p.send(job)
+		return
+	default:
+	}
+
+	if batch, ok := p.batches[tripID]; ok {
+		batch.jobs = append(batch.jobs, job)
+		return
+	}
+
+	p.wg.Add(1)
+	batch := &inviteBatch{jobs: []PersistedJob{job}}
+	batch.timer = time.AfterFunc(batchWindow, func() {
+		defer p.wg.Done()
+		p.flushBatch(tripID)
+	})
+	p.batches[tripID] = batch
+}
+
+// flushBatch renders every invite queued for tripID into a single digest
+// e-mail to the trip owner and delivers it, marking each underlying invite
+// job sent or failed as a group.
+func (p *Pool) flushBatch(tripID string) {
+	p.batchMu.Lock()
+	batch, ok := p.batches[tripID]
+	delete(p.batches, tripID)
+	p.batchMu.Unlock()
+
+	if !ok || len(batch.jobs) == 0 {
+		return
+	}
+
+	first := batch.jobs[0].Message
+
+	ownerEmail := first.Data["ownerEmail"]
+	if ownerEmail == "" {
+		p.logger.Error("notifier: dropping invite digest with no owner e-mail", zap.String("trip_id", tripID))
+		return
+	}
+
+	emails := make([]string, len(batch.jobs))
+	for i, job := range batch.jobs {
+		emails[i] = job.Message.To
+	}
+
+	data := make(map[string]string, len(first.Data)+2)
+	for k, v := range first.Data {
+		data[k] = v
+	}
+	data["inviteCount"] = fmt.Sprintf("%d", len(batch.jobs))
+	data["inviteeEmails"] = strings.Join(emails, ", ")
+
+	digest := Message{
+		To:       ownerEmail,
+		Channel:  ChannelEmail,
+		Template: "trip-owner-invites-digest",
+		Data:     data,
+	}
+
+	p.deliverBatch(batch.jobs, digest)
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			p.deliver(job)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// deliverWithRetry calls send starting at startAttempt, reporting each
+// attempt's outcome to onResult, retrying with exponential backoff up to
+// maxAttempts. It stops early if the pool is shutting down.
+func (p *Pool) deliverWithRetry(startAttempt int, send func() error, onResult func(attempt int, err error)) {
+	backoff := initialBackoff
+
+	for attempt := startAttempt; attempt <= maxAttempts; attempt++ {
+		err := send()
+		onResult(attempt, err)
+		if err == nil || attempt == maxAttempts {
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-p.done:
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// notifyWithTimeout bounds a single delivery attempt to deliverTimeout, so a
+// slow or unresponsive SMTP server or webhook endpoint fails that attempt
+// instead of hanging its worker goroutine forever - retry/backoff handles
+// moving on from there, the same as any other delivery error.
+func (p *Pool) notifyWithTimeout(event string, msg Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deliverTimeout)
+	defer cancel()
+	return p.notifier.Notify(ctx, event, msg)
+}
+
+func (p *Pool) deliver(job PersistedJob) {
+	p.deliverWithRetry(job.Attempt+1,
+		func() error { return p.notifyWithTimeout(job.Event, job.Message) },
+		func(attempt int, err error) {
+			if err == nil {
+				if markErr := p.store.MarkJobSent(context.Background(), job.ID); markErr != nil {
+					p.logger.Error("notifier: failed to mark job sent", zap.Error(markErr), zap.String("job_id", job.ID.String()))
+				}
+				return
+			}
+
+			p.logger.Warn("notifier: delivery attempt failed",
+				zap.Error(err), zap.String("job_id", job.ID.String()), zap.Int("attempt", attempt))
+
+			if markErr := p.store.MarkJobFailed(context.Background(), job.ID, attempt, err.Error()); markErr != nil {
+				p.logger.Error("notifier: failed to record job failure", zap.Error(markErr), zap.String("job_id", job.ID.String()))
+			}
+
+			if attempt == maxAttempts {
+				p.logger.Error("notifier: giving up on job after max attempts", zap.String("job_id", job.ID.String()))
+			}
+		},
+	)
+}
+
+// deliverBatch sends digest and marks every job it was rendered from sent
+// or failed, together, so a retry resends the whole digest rather than a
+// partial one.
+func (p *Pool) deliverBatch(jobs []PersistedJob, digest Message) {
+	p.deliverWithRetry(1,
+		func() error { return p.notifyWithTimeout(eventParticipantInvitedBatch, digest) },
+		func(attempt int, err error) {
+			if err == nil {
+				for _, job := range jobs {
+					if markErr := p.store.MarkJobSent(context.Background(), job.ID); markErr != nil {
+						p.logger.Error("notifier: failed to mark batched job sent", zap.Error(markErr), zap.String("job_id", job.ID.String()))
+					}
+				}
+				return
+			}
+
+			p.logger.Warn("notifier: batched delivery attempt failed",
+				zap.Error(err), zap.Int("invites", len(jobs)), zap.Int("attempt", attempt))
+
+			for _, job := range jobs {
+				if markErr := p.store.MarkJobFailed(context.Background(), job.ID, attempt, err.Error()); markErr != nil {
+					p.logger.Error("notifier: failed to record batched job failure", zap.Error(markErr), zap.String("job_id", job.ID.String()))
+				}
+			}
+
+			if attempt == maxAttempts {
+				p.logger.Error("notifier: giving up on invite digest after max attempts", zap.Int("invites", len(jobs)))
+			}
+		},
+	)
+}
+
+// Shutdown stops accepting new deliveries, cancels any batch timers that
+// haven't fired yet (their jobs stay pending in the store for the next
+// Start to pick up), and waits for in-flight sends to finish, or for ctx to
+// expire, whichever comes first.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	close(p.done)
+
+	p.batchMu.Lock()
+	for tripID, batch := range p.batches {
+		if batch.timer.Stop() {
+			p.wg.Done()
+		}
+		delete(p.batches, tripID)
+	}
+	p.batchMu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
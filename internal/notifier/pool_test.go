@@ -0,0 +1,140 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// poolFakeStore is a minimal in-memory Store: EnqueueJob mints an ID,
+// MarkJobSent/MarkJobFailed just record which IDs were called.
+type poolFakeStore struct {
+	mu     sync.Mutex
+	sent   []uuid.UUID
+	failed []uuid.UUID
+}
+
+func (s *poolFakeStore) EnqueueJob(context.Context, string, Message) (uuid.UUID, error) {
+	return uuid.New(), nil
+}
+
+func (s *poolFakeStore) MarkJobSent(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, id)
+	return nil
+}
+
+func (s *poolFakeStore) MarkJobFailed(_ context.Context, id uuid.UUID, _ int, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = append(s.failed, id)
+	return nil
+}
+
+func (s *poolFakeStore) ListPendingJobs(context.Context) ([]PersistedJob, error) {
+	return nil, nil
+}
+
+func (s *poolFakeStore) sentCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+// countingProvider records how many times Send was called.
+type countingProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *countingProvider) Send(context.Context, Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return nil
+}
+
+func (p *countingProvider) callCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+// TestPool_ShutdownCancelsPendingBatch verifies that Shutdown stops a
+// scheduled invite-batch timer before it fires: the digest must not go out
+// once the pool is draining, and the underlying invite jobs must be left
+// untouched (still "pending" in the store) for the next Start to redeliver.
+func TestPool_ShutdownCancelsPendingBatch(t *testing.T) {
+	provider := &countingProvider{}
+	store := &poolFakeStore{}
+	pool := NewPool(New(map[Channel][]Provider{ChannelEmail: {provider}}), store, zap.NewNop(), 1)
+
+	err := pool.Notify(context.Background(), eventParticipantInvited, Message{
+		To:      "participant@example.com",
+		Channel: ChannelEmail,
+		Data:    map[string]string{"tripID": "trip-1", "ownerEmail": "owner@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	// batchWindow is 5s; shutting down right away must beat the timer,
+	// exercising the race between a scheduled flush and Shutdown instead of
+	// waiting the window out.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if calls := provider.callCount(); calls != 0 {
+		t.Fatalf("expected the pending batch to be cancelled, provider was called %d time(s)", calls)
+	}
+	if sent := store.sentCount(); sent != 0 {
+		t.Fatalf("expected no job to be marked sent, got %d", sent)
+	}
+}
+
+// TestPool_NotifyRacingShutdownDoesNotPanic guards against scheduleBatch
+// calling wg.Add concurrently with the wg.Wait Shutdown starts once it's
+// done draining p.batches - a sync.WaitGroup misuse that panics rather than
+// merely misbehaving, so a clean run here is a real guarantee, not a coin
+// flip. Each goroutine schedules a distinct trip's batch so every call
+// reaches the wg.Add path instead of just appending to an existing one.
+func TestPool_NotifyRacingShutdownDoesNotPanic(t *testing.T) {
+	provider := &countingProvider{}
+	store := &poolFakeStore{}
+	pool := NewPool(New(map[Channel][]Provider{ChannelEmail: {provider}}), store, zap.NewNop(), 2)
+
+	const notifiers = 50
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < notifiers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_ = pool.Notify(context.Background(), eventParticipantInvited, Message{
+				To:      "participant@example.com",
+				Channel: ChannelEmail,
+				Data:    map[string]string{"tripID": fmt.Sprintf("trip-%d", i), "ownerEmail": "owner@example.com"},
+			})
+		}(i)
+	}
+
+	close(start)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	wg.Wait()
+}
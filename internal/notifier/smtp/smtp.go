@@ -0,0 +1,70 @@
+// Package smtp is a generic notifier.Provider that renders a template and
+// delivers it over SMTP. Unlike the old Mailpit-only client, the host,
+// port, TLS policy and credentials are all configurable, so it works
+// against any SMTP server, not just the demo Docker setup.
+package smtp
+
+import (
+	"context"
+	"fmt"
+	"github.com/wneessen/go-mail"
+	"journey/internal/notifier"
+	"journey/internal/notifier/template"
+)
+
+// Config holds the connection details for an SMTP server.
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLS      mail.TLSPolicy
+}
+
+// Provider delivers notifier.Messages over SMTP.
+type Provider struct {
+	cfg       Config
+	templates template.Loader
+}
+
+// NewProvider creates an SMTP provider that renders templates loaded by
+// templates before sending them through the server described by cfg.
+func NewProvider(cfg Config, templates template.Loader) Provider {
+	return Provider{cfg: cfg, templates: templates}
+}
+
+func (p Provider) Send(ctx context.Context, msg notifier.Message) error {
+	tmpl, err := p.templates.Load(msg.Template)
+	if err != nil {
+		return fmt.Errorf("smtp: failed to load template %q: %w", msg.Template, err)
+	}
+
+	m := mail.NewMsg()
+	if err := m.From(p.cfg.From); err != nil {
+		return fmt.Errorf("smtp: failed to set From: %w", err)
+	}
+	if err := m.To(msg.To); err != nil {
+		return fmt.Errorf("smtp: failed to set To: %w", err)
+	}
+
+	m.Subject(tmpl.Subject)
+	m.SetBodyString(mail.TypeTextPlain, template.Render(tmpl.Text, msg.Data))
+	m.AddAlternativeString(mail.TypeTextHTML, template.RenderHTML(tmpl.HTML, msg.Data))
+
+	opts := []mail.Option{mail.WithTLSPortPolicy(p.cfg.TLS), mail.WithPort(p.cfg.Port)}
+	if p.cfg.Username != "" {
+		opts = append(opts, mail.WithSMTPAuth(mail.SMTPAuthPlain), mail.WithUsername(p.cfg.Username), mail.WithPassword(p.cfg.Password))
+	}
+
+	client, err := mail.NewClient(p.cfg.Host, opts...)
+	if err != nil {
+		return fmt.Errorf("smtp: failed to create client: %w", err)
+	}
+
+	if err := client.DialAndSendWithContext(ctx, m); err != nil {
+		return fmt.Errorf("smtp: failed to send: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+// Package template loads named email templates from disk and substitutes
+// `{variable}` placeholders at send time. Each template has an HTML body
+// (which may be authored as MJML and pre-compiled to HTML) and a matching
+// plaintext alternative. When a template file is missing on disk, a
+// built-in default is used instead, so the mailer keeps working out of the
+// box while still letting operators override copy without recompiling.
+package template
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Template holds the HTML and plaintext bodies for a single named email.
+type Template struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Loader reads named templates from a directory on disk, falling back to
+// built-in defaults when a template file does not exist.
+type Loader struct {
+	dir string
+}
+
+// NewLoader creates a Loader that reads templates from dir. dir does not
+// need to exist: if it's empty or missing, every template resolves to its
+// built-in default.
+func NewLoader(dir string) Loader {
+	return Loader{dir: dir}
+}
+
+// Load returns the template registered under name, reading
+// "<name>.html" and "<name>.txt" from the loader's directory when present.
+// Any file that's missing or unreadable falls back to the built-in default
+// for that name. When name has no built-in default, both files must exist
+// on disk; a missing one of them is an error.
+func (l Loader) Load(name string) (Template, error) {
+	tmpl, hasDefault := defaults[name]
+
+	if html, err := os.ReadFile(filepath.Join(l.dir, name+".html")); err == nil {
+		tmpl.HTML = string(html)
+	} else if !hasDefault {
+		return Template{}, fmt.Errorf("template: no default for %q and %s.html not found: %w", name, name, err)
+	}
+
+	if text, err := os.ReadFile(filepath.Join(l.dir, name+".txt")); err == nil {
+		tmpl.Text = string(text)
+	} else if !hasDefault {
+		return Template{}, fmt.Errorf("template: no default for %q and %s.txt not found: %w", name, name, err)
+	}
+
+	return tmpl, nil
+}
+
+// Render substitutes every `{key}` occurrence in body with vars[key].
+// Keys with no matching variable are left untouched.
+func Render(body string, vars map[string]string) string {
+	return render(body, vars, false)
+}
+
+// RenderHTML behaves like Render, except every substituted value is
+// HTML-escaped first. vars come straight from request bodies (trip
+// destinations, names, ...) with no sanitization of their own, so this is
+// what a template's HTML body must use instead of Render - otherwise a
+// value like a destination named "<img src=x onerror=...>" would render
+// live into an e-mail sent to a third party.
+func RenderHTML(body string, vars map[string]string) string {
+	return render(body, vars, true)
+}
+
+func render(body string, vars map[string]string, escape bool) string {
+	replacements := make([]string, 0, len(vars)*2)
+	for key, value := range vars {
+		if escape {
+			value = html.EscapeString(value)
+		}
+		replacements = append(replacements, "{"+key+"}", value)
+	}
+	return strings.NewReplacer(replacements...).Replace(body)
+}
+
+// defaults for "trip-owner-confirm" and "participant-invite" are generated
+// from the plaintext copy the mailer used to send before templates existed,
+// so those e-mails read the same when no template file is present on disk.
+// "trip-confirmed" and "trip-owner-invites-digest" have no earlier copy.
+var defaults = map[string]Template{
+	"trip-owner-confirm": {
+		Subject: "Confirme sua viagem!!!",
+		HTML: `<p>Olá, {ownerName}</p>
+<p>A sua viagem para {destination} que começa no dia {startsAt} precisa ser confirmada.</p>
+<p><a href="{confirmURL}">Clique aqui para confirmar</a>.</p>`,
+		Text: `Olá, {ownerName}
+
+A sua viagem para {destination} que começa no dia {startsAt} precisa ser confirmada.
+Clique no link abaixo para confirmar.
+{confirmURL}
+`,
+	},
+	"participant-invite": {
+		Subject: "Confirme sua viagem!!!",
+		HTML: `<p>Olá, Convidado</p>
+<p>A sua viagem para {destination} que começa no dia {startsAt} precisa ser confirmada.</p>
+<p><a href="{confirmURL}">Clique aqui para confirmar</a>.</p>`,
+		Text: `Olá, Convidado
+
+A sua viagem para {destination} que começa no dia {startsAt} precisa ser confirmada.
+Clique no link abaixo para confirmar.
+{confirmURL}
+`,
+	},
+	"trip-confirmed": {
+		Subject: "Viagem confirmada!",
+		HTML: `<p>Olá, {ownerName}</p>
+<p>Sua viagem para {destination}, começando em {startsAt}, foi confirmada.</p>`,
+		Text: `Olá, {ownerName}
+
+Sua viagem para {destination}, começando em {startsAt}, foi confirmada.
+`,
+	},
+	"trip-owner-invites-digest": {
+		Subject: "Novos convidados na sua viagem",
+		HTML: `<p>Olá, {ownerName}</p>
+<p>{inviteCount} pessoa(s) foram convidadas para a sua viagem para {destination}, começando em {startsAt}:</p>
+<p>{inviteeEmails}</p>`,
+		Text: `Olá, {ownerName}
+
+{inviteCount} pessoa(s) foram convidadas para a sua viagem para {destination}, começando em {startsAt}:
+{inviteeEmails}
+`,
+	},
+}
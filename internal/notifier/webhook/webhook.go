@@ -0,0 +1,56 @@
+// Package webhook is a notifier.Provider that POSTs a JSON payload to a
+// user-configured URL, so operators can wire Slack, Discord, SMS gateways
+// or any other webhook-based integration without touching handler code.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"journey/internal/notifier"
+	"net/http"
+)
+
+// Provider delivers notifier.Messages by POSTing them as JSON to url.
+type Provider struct {
+	url    string
+	client *http.Client
+}
+
+// NewProvider creates a webhook provider that posts to url using the
+// default HTTP client.
+func NewProvider(url string) Provider {
+	return Provider{url: url, client: http.DefaultClient}
+}
+
+type payload struct {
+	To       string            `json:"to"`
+	Template string            `json:"template"`
+	Data     map[string]string `json:"data"`
+}
+
+func (p Provider) Send(ctx context.Context, msg notifier.Message) error {
+	body, err := json.Marshal(payload{To: msg.To, Template: msg.Template, Data: msg.Data})
+	if err != nil {
+		return fmt.Errorf("webhook: failed to encode message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook: failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: failed to POST to %s: %w", p.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s responded with status %d", p.url, resp.StatusCode)
+	}
+
+	return nil
+}